@@ -0,0 +1,75 @@
+package metrics
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Prometheus is a Prometheus-backed Recorder.
+type Prometheus struct {
+	request   *prometheus.HistogramVec
+	hop       *prometheus.HistogramVec
+	loopTotal *prometheus.CounterVec
+}
+
+// NewPrometheus constructs a Prometheus Recorder and registers its
+// collectors with reg.
+func NewPrometheus(reg prometheus.Registerer) (*Prometheus, error) {
+	p := &Prometheus{
+		request: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "skywire",
+			Subsystem: "setup",
+			Name:      "request_duration_seconds",
+			Help:      "Duration of a setup node request (create or close loop), by result.",
+		}, []string{"result"}),
+		hop: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "skywire",
+			Subsystem: "setup",
+			Name:      "hop_duration_seconds",
+			Help:      "Duration of a single per-hop RPC, by operation and result.",
+		}, []string{"op", "result"}),
+		loopTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "skywire",
+			Subsystem: "setup",
+			Name:      "loop_total",
+			Help:      "Count of completed loop setups, by result and hop count.",
+		}, []string{"result", "hops"}),
+	}
+
+	for _, c := range []prometheus.Collector{p.request, p.hop, p.loopTotal} {
+		if err := reg.Register(c); err != nil {
+			return nil, err
+		}
+	}
+
+	return p, nil
+}
+
+// Record implements Recorder.
+func (p *Prometheus) Record(elapsed time.Duration, isErr bool) {
+	result := "success"
+	if isErr {
+		result = "error"
+	}
+	p.request.WithLabelValues(result).Observe(elapsed.Seconds())
+}
+
+// RecordHop implements Recorder.
+func (p *Prometheus) RecordHop(op HopOp, elapsed time.Duration, isErr bool) {
+	result := "success"
+	if isErr {
+		result = "error"
+	}
+	p.hop.WithLabelValues(string(op), result).Observe(elapsed.Seconds())
+}
+
+// RecordLoop implements Recorder.
+func (p *Prometheus) RecordLoop(forwardHops, reverseHops int, result LoopResult) {
+	hops := forwardHops
+	if reverseHops > hops {
+		hops = reverseHops
+	}
+	p.loopTotal.WithLabelValues(string(result), strconv.Itoa(hops)).Inc()
+}
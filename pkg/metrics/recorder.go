@@ -0,0 +1,38 @@
+package metrics
+
+import "time"
+
+// HopOp identifies which per-hop RPC a hop-duration observation belongs to.
+type HopOp string
+
+const (
+	// HopOpRequestRouteID tags a requestRouteID RPC.
+	HopOpRequestRouteID HopOp = "request_id"
+	// HopOpAddRule tags a setupRule RPC.
+	HopOpAddRule HopOp = "add_rule"
+)
+
+// LoopResult is the terminal outcome of a createLoop transaction.
+type LoopResult string
+
+const (
+	LoopResultSuccess        LoopResult = "success"
+	LoopResultHopTimeout     LoopResult = "hop_timeout"
+	LoopResultHopError       LoopResult = "hop_error"
+	LoopResultConfirmFailed  LoopResult = "confirm_failed"
+	LoopResultRollbackFailed LoopResult = "rollback_failed"
+)
+
+// Recorder records setup node metrics.
+type Recorder interface {
+	// Record records the outcome of a single setup request (create or
+	// close loop).
+	Record(elapsed time.Duration, isErr bool)
+
+	// RecordHop records the latency and outcome of a single per-hop RPC.
+	RecordHop(op HopOp, elapsed time.Duration, isErr bool)
+
+	// RecordLoop records the lifetime outcome of a createLoop transaction,
+	// including how many hops made up the forward/reverse routes.
+	RecordLoop(forwardHops, reverseHops int, result LoopResult)
+}
@@ -0,0 +1,74 @@
+package setup
+
+import (
+	"time"
+
+	"github.com/skycoin/dmsg/cipher"
+)
+
+// DefaultSetupTimeout is used when Config.SetupTimeout is unset.
+const DefaultSetupTimeout = 10 * time.Second
+
+// DefaultRollbackBudget is used when Config.RollbackBudget is unset.
+const DefaultRollbackBudget = 30 * time.Second
+
+// TransportType identifies which transport.Factory implementation a setup
+// Node should dial/accept over.
+//
+// The Node itself is transport-agnostic: it dials and accepts purely
+// through the transport.Factory interface. Of the four values below,
+// only TransportDmsg has a client in this tree today - TransportSTCP,
+// TransportSTCPR and TransportSUDPH are reserved for when
+// pkg/transport/{stcp,stcpr,sudph} clients land, and newMessenger rejects
+// them rather than pretending they work.
+type TransportType string
+
+const (
+	// TransportDmsg runs the setup node over the dmsg messaging network.
+	TransportDmsg TransportType = "dmsg"
+	// TransportSTCP is reserved for running the setup node over direct TCP
+	// transports. Not yet implemented: selecting it is rejected by
+	// newMessenger.
+	TransportSTCP TransportType = "stcp"
+	// TransportSTCPR is reserved for running the setup node over relayed
+	// TCP transports. Not yet implemented: selecting it is rejected by
+	// newMessenger.
+	TransportSTCPR TransportType = "stcpr"
+	// TransportSUDPH is reserved for running the setup node over UDP
+	// hole-punched transports. Not yet implemented: selecting it is
+	// rejected by newMessenger.
+	TransportSUDPH TransportType = "sudph"
+)
+
+// String implements fmt.Stringer.
+func (t TransportType) String() string { return string(t) }
+
+// MessagingConfig configures the connection to the dmsg messaging network.
+type MessagingConfig struct {
+	Discovery   string `json:"discovery"`
+	ServerCount int    `json:"server_count"`
+}
+
+// Config configures a setup Node.
+type Config struct {
+	PubKey cipher.PubKey `json:"public_key"`
+	SecKey cipher.SecKey `json:"secret_key"`
+
+	// TransportType selects the transport.Factory the Node dials/accepts
+	// over. Defaults to TransportDmsg when empty.
+	TransportType TransportType `json:"transport_type"`
+
+	Messaging MessagingConfig `json:"messaging"`
+
+	// SetupTimeout bounds how long a single setup request (loop create or
+	// close) may run before it is aborted. Defaults to DefaultSetupTimeout
+	// when zero.
+	SetupTimeout time.Duration `json:"setup_timeout"`
+
+	// RollbackBudget bounds how long a single rollback, covering every hop
+	// whose rules a failed setup installed, may retry (with exponential
+	// backoff) before giving up. Defaults to DefaultRollbackBudget when zero.
+	RollbackBudget time.Duration `json:"rollback_budget"`
+
+	LogLevel string `json:"log_level"`
+}
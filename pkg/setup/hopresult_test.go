@@ -0,0 +1,57 @@
+package setup
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/skycoin/dmsg/cipher"
+	"github.com/skycoin/skycoin/src/util/logging"
+
+	"github.com/skycoin/skywire/pkg/metrics"
+	"github.com/skycoin/skywire/pkg/transport"
+)
+
+// ctxErrFactory is a transport.Factory that, like a real dmsg/stcp/...
+// client, gives up on Dial as soon as ctx is done and returns ctx.Err().
+type ctxErrFactory struct{}
+
+func (ctxErrFactory) Dial(ctx context.Context, pk cipher.PubKey) (transport.Transport, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func (ctxErrFactory) Accept(ctx context.Context) (transport.Transport, error) {
+	return nil, errors.New("ctxErrFactory: accept not implemented")
+}
+
+func (ctxErrFactory) Local() cipher.PubKey { return cipher.PubKey{} }
+
+func (ctxErrFactory) Close() error { return nil }
+
+// TestHopResultClassifiesDeadlineExceeded guards against %s-wrapping
+// severing the error chain between a dial timeout and hopResult: every
+// fmt.Errorf on the requestRouteID/setupRule/removeRule/negotiateLoopKey
+// paths must use %w so errors.Is(err, context.DeadlineExceeded) still
+// succeeds once the error reaches hopResult.
+func TestHopResultClassifiesDeadlineExceeded(t *testing.T) {
+	sn := &Node{
+		Logger:    logging.NewMasterLogger().PackageLogger("test"),
+		messenger: ctxErrFactory{},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+
+	_, err := sn.requestRouteID(ctx, sn.Logger, cipher.PubKey{})
+	if err == nil {
+		t.Fatal("expected requestRouteID to fail once ctx is done")
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected err to wrap context.DeadlineExceeded, got: %s", err)
+	}
+	if got := hopResult(err); got != metrics.LoopResultHopTimeout {
+		t.Fatalf("expected hopResult to classify a deadline-exceeded error as %s, got %s", metrics.LoopResultHopTimeout, got)
+	}
+}
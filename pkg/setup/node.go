@@ -24,12 +24,47 @@ type Hop struct {
 	routeID routing.RouteID
 }
 
+// setupContext carries a correlation-scoped logger through a single setup
+// transaction (one createLoop or closeLoop call), so every log line it
+// produces - including those from concurrent per-hop goroutines spawned by
+// createRoute - can be grepped by loop_id rather than interleaving with
+// every other in-flight transaction.
+type setupContext struct {
+	log *logging.Logger
+}
+
+// newSetupContext derives a setupContext for the loop identified by
+// initiator/responder, tagging every log line it produces with loop_id,
+// initiator and responder fields.
+func (sn *Node) newSetupContext(loopID string, initiator, responder cipher.PubKey) *setupContext {
+	return &setupContext{
+		log: sn.Logger.
+			WithField("loop_id", loopID).
+			WithField("initiator", initiator).
+			WithField("responder", responder),
+	}
+}
+
+// hopLog returns a child logger tagging log lines produced while setting
+// up the hop at the given index with hop_index and hop_pk. route_id is not
+// known yet at that point; requestRouteID adds it to the line it logs once
+// the hop has assigned one.
+func (sc *setupContext) hopLog(idx int, pk cipher.PubKey) *logging.Logger {
+	return sc.log.WithField("hop_index", idx).WithField("hop_pk", pk)
+}
+
 // Node performs routes setup operations over messaging channel.
 type Node struct {
-	Logger    *logging.Logger
-	messenger *dmsg.Client
-	srvCount  int
-	metrics   metrics.Recorder
+	Logger         *logging.Logger
+	messenger      transport.Factory
+	secKey         cipher.SecKey
+	srvCount       int
+	setupTimeout   time.Duration
+	rollbackBudget time.Duration
+	metrics        metrics.Recorder
+
+	txnsMu sync.Mutex
+	txns   map[string]*setupTxn
 }
 
 // NewNode constructs a new SetupNode.
@@ -41,27 +76,63 @@ func NewNode(conf *Config, metrics metrics.Recorder) (*Node, error) {
 	if lvl, err := logging.LevelFromString(conf.LogLevel); err == nil {
 		logger.SetLevel(lvl)
 	}
-	messenger := dmsg.NewClient(pk, sk, disc.NewHTTP(conf.Messaging.Discovery), dmsg.SetLogger(logger.PackageLogger(dmsg.Type)))
+
+	messenger, err := newMessenger(conf, logger)
+	if err != nil {
+		return nil, fmt.Errorf("messenger: %w", err)
+	}
+
+	setupTimeout := conf.SetupTimeout
+	if setupTimeout == 0 {
+		setupTimeout = DefaultSetupTimeout
+	}
+
+	rollbackBudget := conf.RollbackBudget
+	if rollbackBudget == 0 {
+		rollbackBudget = DefaultRollbackBudget
+	}
 
 	return &Node{
-		Logger:    logger.PackageLogger("routesetup"),
-		metrics:   metrics,
-		messenger: messenger,
-		srvCount:  conf.Messaging.ServerCount,
+		Logger:         logger.PackageLogger("routesetup"),
+		metrics:        metrics,
+		messenger:      messenger,
+		secKey:         sk,
+		srvCount:       conf.Messaging.ServerCount,
+		setupTimeout:   setupTimeout,
+		rollbackBudget: rollbackBudget,
+		txns:           make(map[string]*setupTxn),
 	}, nil
 }
 
+// newMessenger constructs the transport.Factory to use based on
+// conf.TransportType, defaulting to dmsg when unset. TransportSTCP,
+// TransportSTCPR and TransportSUDPH are reserved for pluggability but have
+// no backing client in this tree yet, so selecting them is reported as an
+// error rather than left to fail at import time.
+func newMessenger(conf *Config, logger *logging.MasterLogger) (transport.Factory, error) {
+	switch conf.TransportType {
+	case "", TransportDmsg:
+		return dmsg.NewClient(conf.PubKey, conf.SecKey, disc.NewHTTP(conf.Messaging.Discovery), dmsg.SetLogger(logger.PackageLogger(dmsg.Type))), nil
+	case TransportSTCP, TransportSTCPR, TransportSUDPH:
+		return nil, fmt.Errorf("transport type %s is not yet implemented", conf.TransportType)
+	default:
+		return nil, fmt.Errorf("unknown transport type: %s", conf.TransportType)
+	}
+}
+
 // Serve starts transport listening loop.
 func (sn *Node) Serve(ctx context.Context) error {
-	if sn.srvCount > 0 {
-		if err := sn.messenger.InitiateServerConnections(ctx, sn.srvCount); err != nil {
-			return fmt.Errorf("messaging: %s", err)
+	if sc, ok := sn.messenger.(transport.ServerConnector); ok && sn.srvCount > 0 {
+		if err := sc.InitiateServerConnections(ctx, sn.srvCount); err != nil {
+			return fmt.Errorf("messaging: %w", err)
 		}
 		sn.Logger.Info("Connected to messaging servers")
 	}
 
 	sn.Logger.Info("Starting Setup Node")
 
+	go sn.reconcileLoop(ctx)
+
 	for {
 		tp, err := sn.messenger.Accept(ctx)
 		if err != nil {
@@ -90,7 +161,9 @@ func (sn *Node) serveTransport(tr transport.Transport) error {
 	case PacketCreateLoop:
 		var ld routing.LoopDescriptor
 		if err = json.Unmarshal(data, &ld); err == nil {
-			err = sn.createLoop(ld)
+			ctx, cancel := sn.requestContext(ld.Expiry)
+			defer cancel()
+			err = sn.createLoop(ctx, ld)
 		}
 	case PacketCloseLoop:
 		var ld routing.LoopData
@@ -98,7 +171,11 @@ func (sn *Node) serveTransport(tr transport.Transport) error {
 			if _, ok := sn.remote(tr.Edges()); !ok {
 				return errors.New("configured PubKey not found in edges")
 			}
-			err = sn.closeLoop(ld.Loop.Remote.PubKey, routing.LoopData{
+			ctx, cancel := sn.requestContext(time.Time{})
+			defer cancel()
+			loopID := fmt.Sprintf("%s:%d-%s:%d", ld.Loop.Local.PubKey, ld.Loop.Local.Port, ld.Loop.Remote.PubKey, ld.Loop.Remote.Port)
+			sc := sn.newSetupContext(loopID, ld.Loop.Local.PubKey, ld.Loop.Remote.PubKey)
+			err = sn.closeLoop(ctx, sc, ld.Loop.Remote.PubKey, routing.LoopData{
 				Loop: routing.Loop{
 					Remote: ld.Loop.Local,
 					Local:  ld.Loop.Remote,
@@ -118,15 +195,66 @@ func (sn *Node) serveTransport(tr transport.Transport) error {
 	return proto.WritePacket(RespSuccess, nil)
 }
 
-func (sn *Node) createLoop(ld routing.LoopDescriptor) error {
-	sn.Logger.Infof("Creating new Loop %s", ld)
-	rRouteID, err := sn.createRoute(ld.Expiry, ld.Reverse, ld.Loop.Local.Port, ld.Loop.Remote.Port)
+// hopResult classifies a hop-level error for LoopResult metrics purposes.
+func hopResult(err error) metrics.LoopResult {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return metrics.LoopResultHopTimeout
+	}
+	return metrics.LoopResultHopError
+}
+
+// requestContext builds a context bounded by both the Node's SetupTimeout
+// and, if set, the loop's expiry, whichever comes first.
+func (sn *Node) requestContext(expireAt time.Time) (context.Context, context.CancelFunc) {
+	deadline := time.Now().Add(sn.setupTimeout)
+	if !expireAt.IsZero() && expireAt.Before(deadline) {
+		deadline = expireAt
+	}
+	return context.WithDeadline(context.Background(), deadline)
+}
+
+func (sn *Node) createLoop(ctx context.Context, ld routing.LoopDescriptor) error {
+	initiator := ld.Initiator()
+	responder := ld.Responder()
+
+	loopID := fmt.Sprintf("%s:%d-%s:%d", initiator, ld.Loop.Local.Port, responder, ld.Loop.Remote.Port)
+	sc := sn.newSetupContext(loopID, initiator, responder)
+	sc.log.Infof("Creating new Loop %s", ld)
+
+	result := metrics.LoopResultSuccess
+	defer func() {
+		sn.metrics.RecordLoop(len(ld.Forward), len(ld.Reverse), result)
+	}()
+
+	txn := newSetupTxn(loopID)
+	sn.trackTxn(txn)
+	defer sn.untrackTxn(txn)
+
+	key, err := routing.GenerateEncryptionKey()
 	if err != nil {
+		result = metrics.LoopResultHopError
+		return fmt.Errorf("encryption key: %w", err)
+	}
+	if err := sn.negotiateLoopKey(ctx, initiator, key); err != nil {
+		result = hopResult(err)
+		return fmt.Errorf("key exchange with initiator: %w", err)
+	}
+	if err := sn.negotiateLoopKey(ctx, responder, key); err != nil {
+		result = hopResult(err)
+		return fmt.Errorf("key exchange with responder: %w", err)
+	}
+
+	rRouteID, err := sn.createRoute(ctx, sc, txn, ld.Expiry, ld.Reverse, ld.Loop.Local.Port, ld.Loop.Remote.Port, key)
+	if err != nil {
+		result = hopResult(err)
+		sn.rollback(sc.log, txn)
 		return err
 	}
 
-	fRouteID, err := sn.createRoute(ld.Expiry, ld.Forward, ld.Loop.Remote.Port, ld.Loop.Local.Port)
+	fRouteID, err := sn.createRoute(ctx, sc, txn, ld.Expiry, ld.Forward, ld.Loop.Remote.Port, ld.Loop.Local.Port, key)
 	if err != nil {
+		result = hopResult(err)
+		sn.rollback(sc.log, txn)
 		return err
 	}
 
@@ -134,9 +262,6 @@ func (sn *Node) createLoop(ld routing.LoopDescriptor) error {
 		return nil
 	}
 
-	initiator := ld.Initiator()
-	responder := ld.Responder()
-
 	ldR := routing.LoopData{
 		Loop: routing.Loop{
 			Remote: routing.Addr{
@@ -150,9 +275,11 @@ func (sn *Node) createLoop(ld routing.LoopDescriptor) error {
 		},
 		RouteID: rRouteID,
 	}
-	if err := sn.connectLoop(responder, ldR); err != nil {
-		sn.Logger.Warnf("Failed to confirm loop with responder: %s", err)
-		return fmt.Errorf("loop connect: %s", err)
+	if err := sn.connectLoop(ctx, sc, responder, ldR); err != nil {
+		sc.log.Warnf("Failed to confirm loop with responder: %s", err)
+		result = metrics.LoopResultConfirmFailed
+		sn.rollback(sc.log, txn)
+		return fmt.Errorf("loop connect: %w", err)
 	}
 
 	ldI := routing.LoopData{
@@ -168,24 +295,27 @@ func (sn *Node) createLoop(ld routing.LoopDescriptor) error {
 		},
 		RouteID: fRouteID,
 	}
-	if err := sn.connectLoop(initiator, ldI); err != nil {
-		sn.Logger.Warnf("Failed to confirm loop with initiator: %s", err)
-		if err := sn.closeLoop(responder, ldR); err != nil {
-			sn.Logger.Warnf("Failed to close loop: %s", err)
+	if err := sn.connectLoop(ctx, sc, initiator, ldI); err != nil {
+		sc.log.Warnf("Failed to confirm loop with initiator: %s", err)
+		result = metrics.LoopResultConfirmFailed
+		if err := sn.closeLoop(ctx, sc, responder, ldR); err != nil {
+			sc.log.Warnf("Failed to close loop: %s", err)
+			result = metrics.LoopResultRollbackFailed
 		}
-		return fmt.Errorf("loop connect: %s", err)
+		sn.rollback(sc.log, txn)
+		return fmt.Errorf("loop connect: %w", err)
 	}
 
-	sn.Logger.Infof("Created Loop %s", ld)
+	sc.log.Infof("Created Loop %s", ld)
 	return nil
 }
 
-func (sn *Node) createRoute(expireAt time.Time, route routing.Route, rport, lport routing.Port) (routing.RouteID, error) {
+func (sn *Node) createRoute(ctx context.Context, sc *setupContext, txn *setupTxn, expireAt time.Time, route routing.Route, rport, lport routing.Port, key routing.EncryptionKey) (routing.RouteID, error) {
 	if len(route) == 0 {
 		return 0, nil
 	}
 
-	sn.Logger.Infof("Creating new Route %s", route)
+	sc.log.Infof("Creating new Route %s", route)
 	r := make([]*Hop, len(route))
 
 	initiator := route[0].From
@@ -194,7 +324,8 @@ func (sn *Node) createRoute(expireAt time.Time, route routing.Route, rport, lpor
 	rulesSetupErrs := make(chan error, len(r))
 
 	// context to cancel rule setup in case of errors
-	ctx, cancel := context.WithCancel(context.Background())
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
 	for idx := len(r) - 1; idx >= 0; idx-- {
 		hop := &Hop{Hop: route[idx]}
 		r[idx] = hop
@@ -205,13 +336,17 @@ func (sn *Node) createRoute(expireAt time.Time, route routing.Route, rport, lpor
 		}
 
 		go func(idx int, hop, nextHop *Hop) {
-			routeID, err := sn.requestRouteID(ctx, hop.To)
+			hopLog := sc.hopLog(idx, hop.To)
+
+			start := time.Now()
+			routeID, err := sn.requestRouteID(ctx, hopLog, hop.To)
+			sn.metrics.RecordHop(metrics.HopOpRequestRouteID, time.Since(start), err != nil)
 			if err != nil {
 				// filter out context cancellation errors
 				if err == context.Canceled {
 					rulesSetupErrs <- err
 				} else {
-					rulesSetupErrs <- fmt.Errorf("rule setup: %s", err)
+					rulesSetupErrs <- fmt.Errorf("rule setup: %w", err)
 				}
 				return
 			}
@@ -220,21 +355,24 @@ func (sn *Node) createRoute(expireAt time.Time, route routing.Route, rport, lpor
 
 			var rule routing.Rule
 			if nextHop == nil {
-				rule = routing.AppRule(expireAt, 0, initiator, lport, rport, routeID)
+				rule = routing.AppRule(expireAt, 0, initiator, lport, rport, routeID, key)
 			} else {
 				rule = routing.ForwardRule(expireAt, nextHop.routeID, nextHop.Transport, routeID)
 			}
 
-			err = sn.setupRule(ctx, hop.To, rule)
+			start = time.Now()
+			err = sn.setupRule(ctx, hopLog, hop.To, rule)
+			sn.metrics.RecordHop(metrics.HopOpAddRule, time.Since(start), err != nil)
 			if err != nil {
 				// filter out context cancellation errors
 				if err == context.Canceled {
 					rulesSetupErrs <- err
 				} else {
-					rulesSetupErrs <- fmt.Errorf("rule setup: %s", err)
+					rulesSetupErrs <- fmt.Errorf("rule setup: %w", err)
 				}
 				return
 			}
+			txn.add(hop.To, routeID)
 
 			// put nil to avoid block
 			rulesSetupErrs <- nil
@@ -259,29 +397,38 @@ func (sn *Node) createRoute(expireAt time.Time, route routing.Route, rport, lpor
 		return 0, rulesSetupErr
 	}
 
-	routeID, err := sn.requestRouteID(context.Background(), initiator)
+	initiatorLog := sc.hopLog(-1, initiator)
+
+	start := time.Now()
+	routeID, err := sn.requestRouteID(ctx, initiatorLog, initiator)
+	sn.metrics.RecordHop(metrics.HopOpRequestRouteID, time.Since(start), err != nil)
 	if err != nil {
-		return 0, fmt.Errorf("request route id: %s", err)
+		return 0, fmt.Errorf("request route id: %w", err)
 	}
 
 	rule := routing.ForwardRule(expireAt, r[0].routeID, r[0].Transport, routeID)
-	if err := sn.setupRule(context.Background(), initiator, rule); err != nil {
-		return 0, fmt.Errorf("rule setup: %s", err)
+
+	start = time.Now()
+	err = sn.setupRule(ctx, initiatorLog, initiator, rule)
+	sn.metrics.RecordHop(metrics.HopOpAddRule, time.Since(start), err != nil)
+	if err != nil {
+		return 0, fmt.Errorf("rule setup: %w", err)
 	}
+	txn.add(initiator, routeID)
 
 	return routeID, nil
 }
 
-func (sn *Node) connectLoop(on cipher.PubKey, ld routing.LoopData) error {
-	ctx := context.Background()
+func (sn *Node) connectLoop(ctx context.Context, sc *setupContext, on cipher.PubKey, ld routing.LoopData) error {
+	log := sc.log.WithField("remote_pk", on)
 
 	tr, err := sn.messenger.Dial(ctx, on)
 	if err != nil {
-		return fmt.Errorf("transport: %s", err)
+		return fmt.Errorf("transport: %w", err)
 	}
 	defer func() {
 		if err := tr.Close(); err != nil {
-			sn.Logger.Warnf("Failed to close transport: %s", err)
+			log.Warnf("Failed to close transport: %s", err)
 		}
 	}()
 
@@ -289,7 +436,7 @@ func (sn *Node) connectLoop(on cipher.PubKey, ld routing.LoopData) error {
 		return err
 	}
 
-	sn.Logger.Infof("Confirmed loop on %s with %s. RemotePort: %d. LocalPort: %d", on, ld.Loop.Remote.PubKey, ld.Loop.Remote.Port, ld.Loop.Local.Port)
+	log.Infof("Confirmed loop on %s with %s. RemotePort: %d. LocalPort: %d", on, ld.Loop.Remote.PubKey, ld.Loop.Remote.Port, ld.Loop.Local.Port)
 	return nil
 }
 
@@ -312,19 +459,18 @@ func (sn *Node) remote(edges [2]cipher.PubKey) (cipher.PubKey, bool) {
 	return cipher.PubKey{}, false
 }
 
-func (sn *Node) closeLoop(on cipher.PubKey, ld routing.LoopData) error {
-	fmt.Printf(">>> BEGIN: closeLoop(%s, ld)\n", on)
-	defer fmt.Printf(">>>   END: closeLoop(%s, ld)\n", on)
-	ctx := context.Background()
+func (sn *Node) closeLoop(ctx context.Context, sc *setupContext, on cipher.PubKey, ld routing.LoopData) error {
+	log := sc.log.WithField("remote_pk", on)
+	log.Debug("Closing loop")
+	defer log.Debug("Closed loop")
 
 	tr, err := sn.messenger.Dial(ctx, on)
-	fmt.Println(">>> *****: closeLoop() dialed:", err)
 	if err != nil {
-		return fmt.Errorf("transport: %s", err)
+		return fmt.Errorf("transport: %w", err)
 	}
 	defer func() {
 		if err := tr.Close(); err != nil {
-			sn.Logger.Warnf("Failed to close transport: %s", err)
+			log.Warnf("Failed to close transport: %s", err)
 		}
 	}()
 
@@ -333,49 +479,55 @@ func (sn *Node) closeLoop(on cipher.PubKey, ld routing.LoopData) error {
 		return err
 	}
 
-	sn.Logger.Infof("Closed loop on %s. LocalPort: %d", on, ld.Loop.Local.Port)
+	log.Infof("Closed loop on %s. LocalPort: %d", on, ld.Loop.Local.Port)
 	return nil
 }
 
-func (sn *Node) requestRouteID(ctx context.Context, pubKey cipher.PubKey) (routing.RouteID, error) {
-	sn.Logger.Debugf("dialing to %s to request route ID\n", pubKey)
+func (sn *Node) requestRouteID(ctx context.Context, log *logging.Logger, pubKey cipher.PubKey) (routing.RouteID, error) {
+	log.Debug("Dialing to request route ID")
 	tr, err := sn.messenger.Dial(ctx, pubKey)
 	if err != nil {
-		return 0, fmt.Errorf("transport: %s", err)
+		return 0, fmt.Errorf("transport: %w", err)
 	}
 	defer func() {
 		if err := tr.Close(); err != nil {
-			sn.Logger.Warnf("Failed to close transport: %s", err)
+			log.Warnf("Failed to close transport: %s", err)
 		}
 	}()
 
-	proto := NewSetupProtocol(tr)
+	proto, err := newHopProtocol(tr, sn.secKey, pubKey)
+	if err != nil {
+		return 0, fmt.Errorf("hop protocol: %w", err)
+	}
 	routeID, err := RequestRouteID(proto)
 	if err != nil {
 		return 0, err
 	}
 
-	sn.Logger.Infof("Received route ID %d from %s", routeID, pubKey)
+	log.WithField("route_id", routeID).Info("Received route ID")
 	return routeID, nil
 }
 
-func (sn *Node) setupRule(ctx context.Context, pubKey cipher.PubKey, rule routing.Rule) error {
-	sn.Logger.Debugf("dialing to %s to setup rule: %v\n", pubKey, rule)
+func (sn *Node) setupRule(ctx context.Context, log *logging.Logger, pubKey cipher.PubKey, rule routing.Rule) error {
+	log.Debugf("Dialing to setup rule: %v", rule)
 	tr, err := sn.messenger.Dial(ctx, pubKey)
 	if err != nil {
-		return fmt.Errorf("transport: %s", err)
+		return fmt.Errorf("transport: %w", err)
 	}
 	defer func() {
 		if err := tr.Close(); err != nil {
-			sn.Logger.Warnf("Failed to close transport: %s", err)
+			log.Warnf("Failed to close transport: %s", err)
 		}
 	}()
 
-	proto := NewSetupProtocol(tr)
+	proto, err := newHopProtocol(tr, sn.secKey, pubKey)
+	if err != nil {
+		return fmt.Errorf("hop protocol: %w", err)
+	}
 	if err := AddRule(proto, rule); err != nil {
 		return err
 	}
 
-	sn.Logger.Infof("Set rule of type %s on %s", rule.Type(), pubKey)
+	log.Infof("Set rule of type %s", rule.Type())
 	return nil
 }
@@ -0,0 +1,62 @@
+package setup
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/skycoin/dmsg/cipher"
+	"github.com/skycoin/skycoin/src/util/logging"
+
+	"github.com/skycoin/skywire/pkg/transport"
+)
+
+// fakeFactory is a minimal in-memory transport.Factory used to show that
+// Node only ever depends on the transport.Factory interface, never a
+// concrete client, so tests can inject one instead of dialing real
+// dmsg/stcp/... servers.
+type fakeFactory struct {
+	local cipher.PubKey
+}
+
+func (f *fakeFactory) Dial(ctx context.Context, pk cipher.PubKey) (transport.Transport, error) {
+	return nil, errors.New("fakeFactory: dial not implemented")
+}
+
+func (f *fakeFactory) Accept(ctx context.Context) (transport.Transport, error) {
+	return nil, errors.New("fakeFactory: accept not implemented")
+}
+
+func (f *fakeFactory) Local() cipher.PubKey { return f.local }
+
+func (f *fakeFactory) Close() error { return nil }
+
+func TestNodeAcceptsInMemoryFactory(t *testing.T) {
+	var pk cipher.PubKey
+	pk[0] = 1
+
+	sn := &Node{messenger: &fakeFactory{local: pk}}
+
+	if got := sn.messenger.Local(); got != pk {
+		t.Fatalf("expected Local() to return the injected factory's key, got %s", got)
+	}
+}
+
+func TestNewMessengerUnknownTransportType(t *testing.T) {
+	conf := &Config{TransportType: TransportType("bogus")}
+
+	if _, err := newMessenger(conf, logging.NewMasterLogger()); err == nil {
+		t.Fatal("expected an error for an unknown transport type")
+	}
+}
+
+func TestNewMessengerNotYetImplementedTransports(t *testing.T) {
+	logger := logging.NewMasterLogger()
+
+	for _, tt := range []TransportType{TransportSTCP, TransportSTCPR, TransportSUDPH} {
+		conf := &Config{TransportType: tt}
+		if _, err := newMessenger(conf, logger); err == nil {
+			t.Fatalf("expected %s to be reported as not yet implemented", tt)
+		}
+	}
+}
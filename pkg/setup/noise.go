@@ -0,0 +1,154 @@
+package setup
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/nacl/box"
+
+	"github.com/skycoin/dmsg/cipher"
+
+	"github.com/skycoin/skywire/pkg/routing"
+	"github.com/skycoin/skywire/pkg/transport"
+)
+
+// packetProtocol is satisfied by both *SetupProtocol and *hopProtocol, so
+// helpers like RequestRouteID and AddRule work unencrypted or encrypted.
+type packetProtocol interface {
+	WritePacket(t PacketType, payload interface{}) error
+	ReadPacket() (PacketType, []byte, error)
+}
+
+// hopProtocol wraps a SetupProtocol dialed to an intermediate hop so every
+// packet written/read is sealed with a key agreed during a per-dial
+// handshake. This keeps the routing.Rule (and the loop identities it
+// carries) opaque to anyone observing the dial who isn't the setup node or
+// that specific hop.
+type hopProtocol struct {
+	proto  *SetupProtocol
+	shared [32]byte
+}
+
+// hopHandshake is the signed ephemeral X25519 public key each side of a
+// hopProtocol sends before the box channel is usable. cipher.PubKey/SecKey
+// are secp256k1 node-identity keys, not Curve25519 points, so they can't be
+// fed into box.Precompute directly: NaCl's ECDH only agrees when both
+// public keys were actually derived as X25519(sk, basepoint), which a
+// secp256k1 key never is, so doing so makes each side compute a different
+// "shared secret" and every OpenAfterPrecomputation fails. Generating a
+// fresh X25519 keypair per dial and signing its public half with the
+// long-term secp256k1 identity key gives a shared secret that is both a
+// valid ECDH output and authenticated against the peer's known identity.
+type hopHandshake struct {
+	EphemeralPK [32]byte
+	Sig         cipher.Sig
+}
+
+func newHopProtocol(tr transport.Transport, localSK cipher.SecKey, remotePK cipher.PubKey) (*hopProtocol, error) {
+	proto := NewSetupProtocol(tr)
+
+	ourPub, ourSec, err := box.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("hop protocol: generate ephemeral key: %w", err)
+	}
+
+	sig, err := cipher.SignHash(cipher.SumSHA256(ourPub[:]), localSK)
+	if err != nil {
+		return nil, fmt.Errorf("hop protocol: sign ephemeral key: %w", err)
+	}
+
+	if err := proto.WritePacket(PacketHopHandshake, hopHandshake{EphemeralPK: *ourPub, Sig: sig}); err != nil {
+		return nil, fmt.Errorf("hop protocol: handshake: %w", err)
+	}
+
+	_, data, err := proto.ReadPacket()
+	if err != nil {
+		return nil, fmt.Errorf("hop protocol: handshake: %w", err)
+	}
+
+	var theirs hopHandshake
+	if err := json.Unmarshal(data, &theirs); err != nil {
+		return nil, fmt.Errorf("hop protocol: malformed handshake from %s: %w", remotePK, err)
+	}
+	if err := cipher.VerifyPubKeySignedHash(remotePK, theirs.Sig, cipher.SumSHA256(theirs.EphemeralPK[:])); err != nil {
+		return nil, fmt.Errorf("hop protocol: handshake signature from %s: %w", remotePK, err)
+	}
+
+	var shared [32]byte
+	box.Precompute(&shared, &theirs.EphemeralPK, ourSec)
+
+	return &hopProtocol{proto: proto, shared: shared}, nil
+}
+
+func (p *hopProtocol) WritePacket(t PacketType, payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("hop protocol: %w", err)
+	}
+
+	var nonce [24]byte
+	if _, err := io.ReadFull(rand.Reader, nonce[:]); err != nil {
+		return fmt.Errorf("hop protocol: nonce: %w", err)
+	}
+
+	sealed := box.SealAfterPrecomputation(nonce[:], body, &nonce, &p.shared)
+	return p.proto.WritePacket(t, sealed)
+}
+
+func (p *hopProtocol) ReadPacket() (PacketType, []byte, error) {
+	t, data, err := p.proto.ReadPacket()
+	if err != nil {
+		return t, nil, err
+	}
+	if len(data) < 24 {
+		return t, nil, fmt.Errorf("hop protocol: short frame")
+	}
+
+	var nonce [24]byte
+	copy(nonce[:], data[:24])
+
+	opened, ok := box.OpenAfterPrecomputation(nil, data[24:], &nonce, &p.shared)
+	if !ok {
+		return t, nil, fmt.Errorf("hop protocol: open failed")
+	}
+
+	return t, opened, nil
+}
+
+// negotiateLoopKey dials on and hands it key over a hopProtocol channel
+// (the same construction requestRouteID/setupRule use): the shared secret
+// comes from per-dial ephemeral X25519 keys, and on's ephemeral key must be
+// signed by on's long-term cipher.PubKey. Because that signature is checked,
+// an active MITM on the dial can't substitute its own key and recover key.
+func (sn *Node) negotiateLoopKey(ctx context.Context, on cipher.PubKey, key routing.EncryptionKey) error {
+	tr, err := sn.messenger.Dial(ctx, on)
+	if err != nil {
+		return fmt.Errorf("transport: %w", err)
+	}
+	defer func() {
+		if err := tr.Close(); err != nil {
+			sn.Logger.Warnf("Failed to close transport: %s", err)
+		}
+	}()
+
+	proto, err := newHopProtocol(tr, sn.secKey, on)
+	if err != nil {
+		return fmt.Errorf("noise: %w", err)
+	}
+	if err := proto.WritePacket(PacketNegotiateEncryption, key[:]); err != nil {
+		return fmt.Errorf("noise: %w", err)
+	}
+
+	respType, _, err := proto.ReadPacket()
+	if err != nil {
+		return fmt.Errorf("noise: %w", err)
+	}
+	if respType != RespSuccess {
+		return fmt.Errorf("noise: %s rejected handshake", on)
+	}
+
+	return nil
+}
@@ -0,0 +1,25 @@
+package setup
+
+// PacketNegotiateEncryption, PacketRemoveRules and PacketHopHandshake
+// extend the package's PacketType enum for the packets added alongside
+// per-loop encryption and rollback support. They are kept here, instead of
+// inline in the files that use them, so related PacketType additions stay
+// easy to find as a group.
+const (
+	// PacketNegotiateEncryption is exchanged between the setup node and a
+	// loop edge to deliver the per-loop EncryptionKey that edge's AppRule
+	// will use.
+	PacketNegotiateEncryption PacketType = 10
+
+	// PacketRemoveRules asks a hop to purge the routing rules for the
+	// given route IDs. It is used to unwind a partially-installed
+	// route/loop after a setup failure, rather than leaving forward-rules
+	// to clear on expiry.
+	PacketRemoveRules PacketType = 11
+
+	// PacketHopHandshake carries a hopHandshake: the signed ephemeral
+	// X25519 public key each side of a hopProtocol dial exchanges before
+	// any PacketNegotiateEncryption/PacketRemoveRules/... payload is sent
+	// over it.
+	PacketHopHandshake PacketType = 12
+)
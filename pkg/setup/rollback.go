@@ -0,0 +1,179 @@
+package setup
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/skycoin/dmsg/cipher"
+	"github.com/skycoin/skycoin/src/util/logging"
+
+	"github.com/skycoin/skywire/pkg/routing"
+)
+
+// installedHop records a single hop where setupRule succeeded, so it can be
+// torn down again if the rest of the loop fails to come up.
+type installedHop struct {
+	pk      cipher.PubKey
+	routeID routing.RouteID
+}
+
+// setupTxn tracks every hop that has had a rule installed during a single
+// createLoop transaction, so a partial failure rolls back the rules it
+// already installed instead of leaking them until they expire.
+type setupTxn struct {
+	loopID    string
+	startedAt time.Time
+
+	mu        sync.Mutex
+	installed []installedHop
+}
+
+func newSetupTxn(loopID string) *setupTxn {
+	return &setupTxn{loopID: loopID, startedAt: time.Now()}
+}
+
+func (t *setupTxn) add(pk cipher.PubKey, routeID routing.RouteID) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.installed = append(t.installed, installedHop{pk: pk, routeID: routeID})
+}
+
+func (t *setupTxn) hops() []installedHop {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]installedHop(nil), t.installed...)
+}
+
+// trackTxn registers txn so the reconciliation loop started in Serve can
+// find and force-rollback it if it outlives the Node's SetupTimeout.
+func (sn *Node) trackTxn(txn *setupTxn) {
+	sn.txnsMu.Lock()
+	defer sn.txnsMu.Unlock()
+	sn.txns[txn.loopID] = txn
+}
+
+func (sn *Node) untrackTxn(txn *setupTxn) {
+	sn.txnsMu.Lock()
+	defer sn.txnsMu.Unlock()
+	delete(sn.txns, txn.loopID)
+}
+
+// rollback purges every rule installed as part of txn. Rolling back the
+// same hop twice is harmless: PacketRemoveRules for a route ID that's
+// already gone is a no-op on the hop's side, so reconcileTxns can safely
+// retry a rollback that a crashed goroutine left half-done.
+//
+// rollback always builds its own context bounded only by the Node's
+// RollbackBudget, rather than taking the caller's request-scoped ctx: the
+// failure that triggers a rollback (most commonly a hop timeout) typically
+// means the request's own deadline has already passed, and rollback must
+// still get its full budget to retry instead of aborting on the first
+// attempt.
+func (sn *Node) rollback(log *logging.Logger, txn *setupTxn) {
+	ctx, cancel := context.WithTimeout(context.Background(), sn.rollbackBudget)
+	defer cancel()
+
+	for _, hop := range txn.hops() {
+		if err := sn.removeRuleWithBackoff(ctx, hop.pk, hop.routeID); err != nil {
+			log.Warnf("Failed to roll back rule %d on %s: %s", hop.routeID, hop.pk, err)
+		}
+	}
+}
+
+// removeRuleWithBackoff sends PacketRemoveRules to pk, retrying with
+// exponential backoff until it succeeds or the Node's RollbackBudget for
+// this rollback attempt is exhausted.
+func (sn *Node) removeRuleWithBackoff(ctx context.Context, pk cipher.PubKey, routeID routing.RouteID) error {
+	backoff := 100 * time.Millisecond
+	deadline := time.Now().Add(sn.rollbackBudget)
+
+	var lastErr error
+	for time.Now().Before(deadline) {
+		if err := sn.removeRule(ctx, pk, routeID); err == nil {
+			return nil
+		} else {
+			lastErr = err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+	}
+
+	return fmt.Errorf("rollback budget exhausted: %w", lastErr)
+}
+
+func (sn *Node) removeRule(ctx context.Context, pk cipher.PubKey, routeID routing.RouteID) error {
+	tr, err := sn.messenger.Dial(ctx, pk)
+	if err != nil {
+		return fmt.Errorf("transport: %w", err)
+	}
+	defer func() {
+		if err := tr.Close(); err != nil {
+			sn.Logger.Warnf("Failed to close transport: %s", err)
+		}
+	}()
+
+	proto, err := newHopProtocol(tr, sn.secKey, pk)
+	if err != nil {
+		return fmt.Errorf("hop protocol: %w", err)
+	}
+	if err := proto.WritePacket(PacketRemoveRules, []routing.RouteID{routeID}); err != nil {
+		return fmt.Errorf("remove rule: %w", err)
+	}
+
+	respType, _, err := proto.ReadPacket()
+	if err != nil {
+		return fmt.Errorf("remove rule: %w", err)
+	}
+	if respType != RespSuccess {
+		return fmt.Errorf("remove rule: %s rejected removal", pk)
+	}
+
+	return nil
+}
+
+// reconcileLoop periodically scans for in-flight transactions that have
+// outlived the Node's SetupTimeout and force-rolls-them-back, until ctx is
+// done.
+func (sn *Node) reconcileLoop(ctx context.Context) {
+	ticker := time.NewTicker(sn.setupTimeout)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			sn.reconcileTxns()
+		}
+	}
+}
+
+// reconcileTxns force-rolls-back any in-flight transaction that has
+// outlived the Node's SetupTimeout. This covers rollbacks that never ran,
+// e.g. because the goroutine driving createLoop died before reaching its
+// own rollback call.
+func (sn *Node) reconcileTxns() {
+	sn.txnsMu.Lock()
+	var stale []*setupTxn
+	for id, txn := range sn.txns {
+		if time.Since(txn.startedAt) > sn.setupTimeout {
+			stale = append(stale, txn)
+			delete(sn.txns, id)
+		}
+	}
+	sn.txnsMu.Unlock()
+
+	for _, txn := range stale {
+		log := sn.Logger.WithField("loop_id", txn.loopID)
+		log.Warn("Reconciling stale setup transaction")
+		sn.rollback(log, txn)
+	}
+}
@@ -0,0 +1,81 @@
+package setup
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/skycoin/dmsg/cipher"
+	"github.com/skycoin/skycoin/src/util/logging"
+
+	"github.com/skycoin/skywire/pkg/routing"
+	"github.com/skycoin/skywire/pkg/transport"
+)
+
+// dialFailFactory is a transport.Factory whose Dial always fails, modelling
+// a hop that's unreachable for the whole rollback - the same condition
+// that produces a LoopResultHopTimeout and triggers rollback in the first
+// place.
+type dialFailFactory struct {
+	mu    sync.Mutex
+	calls int
+}
+
+func (f *dialFailFactory) Dial(ctx context.Context, pk cipher.PubKey) (transport.Transport, error) {
+	f.mu.Lock()
+	f.calls++
+	f.mu.Unlock()
+	return nil, errors.New("dialFailFactory: hop unreachable")
+}
+
+func (f *dialFailFactory) Accept(ctx context.Context) (transport.Transport, error) {
+	return nil, errors.New("dialFailFactory: accept not implemented")
+}
+
+func (f *dialFailFactory) Local() cipher.PubKey { return cipher.PubKey{} }
+
+func (f *dialFailFactory) Close() error { return nil }
+
+func (f *dialFailFactory) callCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls
+}
+
+// TestRollbackRetriesWithinItsOwnBudget guards against rollback inheriting
+// an already-expired request-scoped context: it must keep retrying with
+// backoff for its own RollbackBudget even though nothing bounds it to a
+// shorter, already-elapsed deadline.
+func TestRollbackRetriesWithinItsOwnBudget(t *testing.T) {
+	factory := &dialFailFactory{}
+	sn := &Node{
+		Logger:         logging.NewMasterLogger().PackageLogger("test"),
+		messenger:      factory,
+		rollbackBudget: 150 * time.Millisecond,
+	}
+
+	txn := newSetupTxn("test-loop")
+	txn.add(cipher.PubKey{}, routing.RouteID(1))
+
+	start := time.Now()
+	sn.rollback(sn.Logger, txn)
+	elapsed := time.Since(start)
+
+	if elapsed < sn.rollbackBudget {
+		t.Fatalf("rollback returned after %s, expected it to use its full %s budget", elapsed, sn.rollbackBudget)
+	}
+	if factory.callCount() < 2 {
+		t.Fatalf("expected rollback to retry with backoff, got %d dial attempt(s)", factory.callCount())
+	}
+}
+
+// Note: removeRule's RespSuccess check (added alongside this test) has no
+// equivalent exercise here for a hop that dials fine but rejects the
+// removal at the application level. Driving that path needs a fake
+// transport.Transport that can carry a real hopProtocol handshake and
+// packet exchange, and both transport.Transport and SetupProtocol's wire
+// format are assumed external to this tree rather than defined in it -
+// dialFailFactory above deliberately never gets far enough to need one.
+// Only the dial-failure path is covered until one of those lands.
@@ -0,0 +1,34 @@
+package transport
+
+import (
+	"context"
+
+	"github.com/skycoin/dmsg/cipher"
+)
+
+// Factory is implemented by transport clients that can dial and accept
+// Transports to/from other nodes identified by a public key. It abstracts
+// over the concrete messaging backend (dmsg, stcp, stcpr, sudph, ...) so
+// that consumers such as setup.Node do not need to know which one they are
+// running over.
+type Factory interface {
+	// Dial establishes a Transport with the remote node identified by pk.
+	Dial(ctx context.Context, pk cipher.PubKey) (Transport, error)
+
+	// Accept waits for and returns the next incoming Transport.
+	Accept(ctx context.Context) (Transport, error)
+
+	// Local returns the public key this factory is operating as.
+	Local() cipher.PubKey
+
+	// Close shuts down the factory and releases any underlying resources.
+	Close() error
+}
+
+// ServerConnector is implemented by factories that need to warm up
+// connections to discovery/relay servers before they can Accept or Dial.
+// Not every Factory needs this (e.g. direct TCP transports don't), so it is
+// checked for with a type assertion rather than being part of Factory.
+type ServerConnector interface {
+	InitiateServerConnections(ctx context.Context, n int) error
+}